@@ -0,0 +1,113 @@
+/*
+   Copyright 2019 Metaleaf.io
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package middleware provides a small set of batteries-included
+// router.Middleware implementations for logging, panic recovery, CORS, and
+// X-Forwarded-For rewriting.
+package middleware
+
+import (
+	"fmt"
+	"github.com/metaleaf-io/log"
+	"github.com/metaleaf-io/router"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Logging logs each request's verb, path, and response status using the
+// existing metaleaf-io/log package.
+func Logging() router.Middleware {
+	return func(next router.Handler) router.Handler {
+		return func(writer http.ResponseWriter, request *router.Request) {
+			recorder := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+			next(recorder, request)
+			log.Info("Handled request",
+				log.String("verb", request.Method),
+				log.String("path", request.URL.Path),
+				log.String("status", strconv.Itoa(recorder.status)))
+		}
+	}
+}
+
+// statusRecorder wraps a http.ResponseWriter to capture the status code a
+// handler writes, so Logging can report it after the handler returns.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Recovery recovers from a panic in the wrapped handler, logs it, and
+// responds with a 500 instead of letting the panic unwind into net/http's
+// default handling.
+func Recovery() router.Middleware {
+	return func(next router.Handler) router.Handler {
+		return func(writer http.ResponseWriter, request *router.Request) {
+			defer func() {
+				if r := recover(); r != nil {
+					err, ok := r.(error)
+					if !ok {
+						err = fmt.Errorf("%v", r)
+					}
+					log.Error("Recovered from panic", log.String("path", request.URL.Path), log.Err("error", err))
+					writer.WriteHeader(http.StatusInternalServerError)
+				}
+			}()
+			next(writer, request)
+		}
+	}
+}
+
+// CORS adds the headers needed to allow cross-origin requests from origin
+// (or any origin, if origin is "*"), and answers OPTIONS preflight requests
+// directly rather than passing them to the wrapped handler.
+func CORS(origin string) router.Middleware {
+	return func(next router.Handler) router.Handler {
+		return func(writer http.ResponseWriter, request *router.Request) {
+			writer.Header().Set("Access-Control-Allow-Origin", origin)
+			writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+			if request.Method == http.MethodOptions {
+				writer.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next(writer, request)
+		}
+	}
+}
+
+// ForwardedFor rewrites request.RemoteAddr from the first address in the
+// X-Forwarded-For header, so handlers behind a trusted proxy see the
+// original client address instead of the proxy's.
+func ForwardedFor() router.Middleware {
+	return func(next router.Handler) router.Handler {
+		return func(writer http.ResponseWriter, request *router.Request) {
+			if forwarded := request.Header.Get("X-Forwarded-For"); forwarded != "" {
+				if addr := strings.TrimSpace(strings.Split(forwarded, ",")[0]); addr != "" {
+					request.RemoteAddr = addr
+				}
+			}
+			next(writer, request)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+   Copyright 2019 Metaleaf.io
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package middleware
+
+import (
+	"github.com/metaleaf-io/router"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	r := router.NewRouter()
+	r.Use(Recovery())
+	r.AddRoute("GET", "/boom", func(writer http.ResponseWriter, request *router.Request) {
+		panic("kaboom")
+	})
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/boom")
+	if err != nil {
+		t.Fatalf("GET failed with %v", err)
+	}
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", res.StatusCode)
+	}
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	r := router.NewRouter()
+	r.Use(CORS("*"))
+	r.AddRoute("GET", "/thing", func(writer http.ResponseWriter, request *router.Request) {
+		writer.WriteHeader(http.StatusOK)
+	})
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodOptions, server.URL+"/thing", nil)
+	if err != nil {
+		t.Fatalf("Building request failed with %v", err)
+	}
+
+	res, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("OPTIONS failed with %v", err)
+	}
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", res.StatusCode)
+	}
+	if res.Header.Get("Access-Control-Allow-Origin") != "*" {
+		t.Error("Expected Access-Control-Allow-Origin header to be set")
+	}
+}
+
+func TestCORS_Preflight_SubRouter(t *testing.T) {
+	r := router.NewRouter()
+	api := r.With(CORS("*"))
+	api.AddRoute("GET", "/thing", func(writer http.ResponseWriter, request *router.Request) {
+		writer.WriteHeader(http.StatusOK)
+	})
+
+	// The preflight arrives through the top-level router, not api, so the
+	// Allow-header default must still run api's middleware stack.
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodOptions, server.URL+"/thing", nil)
+	if err != nil {
+		t.Fatalf("Building request failed with %v", err)
+	}
+
+	res, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("OPTIONS failed with %v", err)
+	}
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", res.StatusCode)
+	}
+	if res.Header.Get("Access-Control-Allow-Origin") != "*" {
+		t.Error("Expected Access-Control-Allow-Origin header to be set")
+	}
+}
+
+func TestForwardedFor(t *testing.T) {
+	var remoteAddr string
+
+	r := router.NewRouter()
+	r.Use(ForwardedFor())
+	r.AddRoute("GET", "/whoami", func(writer http.ResponseWriter, request *router.Request) {
+		remoteAddr = request.RemoteAddr
+		writer.WriteHeader(http.StatusOK)
+	})
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/whoami", nil)
+	if err != nil {
+		t.Fatalf("Building request failed with %v", err)
+	}
+	request.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.1")
+
+	if _, err := http.DefaultClient.Do(request); err != nil {
+		t.Fatalf("GET failed with %v", err)
+	}
+
+	if remoteAddr != "203.0.113.9" {
+		t.Errorf("Expected RemoteAddr to be rewritten to 203.0.113.9, got %s", remoteAddr)
+	}
+}
@@ -16,9 +16,17 @@
 package router
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/metaleaf-io/log"
+	"io"
 	"net/http"
+	"net/url"
+	"path"
+	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -27,101 +35,937 @@ type Request struct {
 	// The original request structure.
 	*http.Request
 
-	// Parameters are a hash of key/value strings. These are extracted from
-	// the URL path and the query that appears after a question mark "?" in
-	// the path.
+	// Params is a hash of key/value strings extracted from the URL path,
+	// e.g. the "id" in "/users/{id}".
 	Params map[string]string
+
+	// QueryAll holds every value of every query string parameter, exactly
+	// as net/url.Values represents repeated keys. Most handlers want Query
+	// or QueryValues instead of reading this directly.
+	QueryAll map[string][]string
+}
+
+// Query returns the first value associated with key in the request's query
+// string, or "" if key isn't present.
+func (request *Request) Query(key string) string {
+	values := request.QueryAll[key]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// QueryValues returns every value associated with key in the request's
+// query string.
+func (request *Request) QueryValues(key string) []string {
+	return request.QueryAll[key]
+}
+
+// Bind populates v, a pointer to a struct, from the request. A field tagged
+// `router:"name"` comes from the path parameter of that name, `query:"name"`
+// from the query string, and `header:"name"` from a request header. If the
+// request carries a body, it's decoded as JSON into v first, so tagged
+// fields take precedence over whatever the body supplied.
+func (request *Request) Bind(v interface{}) error {
+	if request.Body != nil {
+		if err := json.NewDecoder(request.Body).Decode(v); err != nil && err != io.EOF {
+			return err
+		}
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("router: Bind requires a pointer to a struct")
+	}
+
+	t := rv.Elem().Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value, ok := request.bindSource(field.Tag)
+		if !ok {
+			continue
+		}
+		if err := setField(rv.Elem().Field(i), value); err != nil {
+			return fmt.Errorf("router: binding field %q: %w", field.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Resolves the string value a struct field's tags pull from the request, in
+// the order router, then query, then header. Only the first of those tags
+// the field carries is consulted, even if the request has no value for it.
+func (request *Request) bindSource(tag reflect.StructTag) (string, bool) {
+	if name, ok := tag.Lookup("router"); ok {
+		value, ok := request.Params[name]
+		return value, ok
+	}
+	if name, ok := tag.Lookup("query"); ok {
+		values := request.QueryAll[name]
+		if len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	}
+	if name, ok := tag.Lookup("header"); ok {
+		value := request.Header.Get(name)
+		return value, value != ""
+	}
+	return "", false
+}
+
+// Converts value into fv, the field of the struct passed to Bind.
+func setField(fv reflect.Value, value string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field kind %s", fv.Kind())
+	}
+	return nil
 }
 
 // Prototype for the handler function.
 type Handler func(http.ResponseWriter, *Request)
 
-// Stores routes added by the application.
+// Prototype for a middleware function, which wraps one Handler to produce
+// another. Middlewares compose around a route's handler in the order they
+// were registered: the first one added via Use runs outermost.
+type Middleware func(Handler) Handler
+
+// Stores routes added by the application as a tree, keyed segment by
+// segment, so that a request path can be matched in time proportional to
+// its length rather than the number of registered routes.
+//
+// A Router value is a view onto a shared route tree: Group and With return
+// new views that add a path prefix or middleware without copying the tree
+// itself, so routes added through any view are visible to all of them.
 type Router struct {
-	routes []route
+	core        *routerCore
+	middlewares []Middleware
+	matchers    []routeMatcher
+	prefix      string
+
+	// MethodNotAllowedHandler, if set, handles a request whose path matches
+	// a registered route but whose verb doesn't. If nil, the router
+	// responds with 405 and an Allow header listing the path's registered
+	// verbs.
+	MethodNotAllowedHandler http.Handler
+
+	// NotFoundHandler, if set, handles a request whose path matches no
+	// registered route. If nil, the router responds with a plain 404.
+	NotFoundHandler http.Handler
+
+	// RedirectCleanPath, if true, redirects a request whose path contains
+	// duplicate slashes or "." or ".." segments to its cleaned form with a
+	// 301 before matching, in the style of julienschmidt/httprouter.
+	RedirectCleanPath bool
+
+	// RedirectTrailingSlash, if true, redirects a request whose path
+	// matches no route but whose trailing-slash-toggled counterpart does:
+	// 301 for GET and HEAD, 307 for other methods, which preserves the
+	// request body on replay.
+	RedirectTrailingSlash bool
 }
 
-// Describes a single route as a combination of HTTP VERB, regular expression
-// path matcher, and the handler function.
-type route struct {
-	verb    string
-	path    *regexp.Regexp
-	handler Handler
+// The route tree and settings shared by a Router and every view derived
+// from it via Group or With.
+type routerCore struct {
+	root       *node
+	paramTypes map[string]string
+	named      map[string]*Route
 }
 
-// Some globals to make life easier.
-var (
-	paramRE = regexp.MustCompile("{(.+?)}")
+// The kind of segment a node matches against.
+type nodeKind int
+
+const (
+	staticNode nodeKind = iota
+	paramNode
+	catchAllNode
 )
 
+// A single node in the route tree. Each node matches exactly one path
+// segment: a literal string, a "{param}" or "{param:type}" wildcard, or a
+// "*param" catch-all that consumes the remainder of the path. Handlers are
+// stored per-verb so that a path can be shared by several HTTP methods.
+type node struct {
+	kind     nodeKind
+	key      string
+	pattern  *regexp.Regexp
+	static   map[string]*node
+	params   []*node
+	catchAll *node
+	handlers map[string][]*Route
+}
+
+// A single registered route: its composed handler plus any predicates
+// narrowing which requests it applies to beyond verb and path. Returned
+// from AddRoute so callers can chain on Host, Headers, Queries, or Schemes.
+type Route struct {
+	handler      Handler
+	matchers     []routeMatcher
+	middlewares  []Middleware
+	core         *routerCore
+	name         string
+	host         string
+	scheme       string
+	pathTemplate string
+}
+
+// A predicate evaluated against the full incoming request, used to further
+// constrain a Route or a Router view beyond verb and path.
+type routeMatcher func(*http.Request) bool
+
+// Host restricts the route to requests whose Host header, ignoring any
+// port, equals host. The host is also used by Router.URL when building a
+// full URL for this route.
+func (route *Route) Host(host string) *Route {
+	route.host = host
+	route.matchers = append(route.matchers, hostMatcher(host))
+	return route
+}
+
+// Name assigns a name to the route so it can be reconstructed later with
+// Router.URL or Router.URLPath.
+func (route *Route) Name(name string) *Route {
+	route.name = name
+	if route.core.named == nil {
+		route.core.named = make(map[string]*Route)
+	}
+	route.core.named[name] = route
+	return route
+}
+
+// Headers restricts the route to requests carrying all of the given
+// key, value, key, value, ... header pairs. An empty value matches any
+// value, as long as the header is present.
+func (route *Route) Headers(pairs ...string) *Route {
+	route.matchers = append(route.matchers, pairMatchers(headerMatcher, pairs)...)
+	return route
+}
+
+// Queries restricts the route to requests carrying all of the given
+// key, value, key, value, ... query string pairs.
+func (route *Route) Queries(pairs ...string) *Route {
+	route.matchers = append(route.matchers, pairMatchers(queryMatcher, pairs)...)
+	return route
+}
+
+// Schemes restricts the route to requests using one of the given URL
+// schemes, e.g. Schemes("https"). The first scheme is also used by
+// Router.URL when building a full URL for this route.
+func (route *Route) Schemes(schemes ...string) *Route {
+	if len(schemes) > 0 {
+		route.scheme = strings.ToLower(schemes[0])
+	}
+	route.matchers = append(route.matchers, schemeMatcher(schemes...))
+	return route
+}
+
+// Reports whether every one of the route's predicates matches request.
+func (route *Route) matches(request *http.Request) bool {
+	for _, m := range route.matchers {
+		if !m(request) {
+			return false
+		}
+	}
+	return true
+}
+
+// Host returns a child router whose routes all additionally require the
+// given Host header, see Route.Host.
+func (router *Router) Host(host string) *Router {
+	return router.withMatchers(hostMatcher(host))
+}
+
+// Headers returns a child router whose routes all additionally require the
+// given header pairs, see Route.Headers.
+func (router *Router) Headers(pairs ...string) *Router {
+	return router.withMatchers(pairMatchers(headerMatcher, pairs)...)
+}
+
+// Queries returns a child router whose routes all additionally require the
+// given query string pairs, see Route.Queries.
+func (router *Router) Queries(pairs ...string) *Router {
+	return router.withMatchers(pairMatchers(queryMatcher, pairs)...)
+}
+
+// Schemes returns a child router whose routes all additionally require one
+// of the given URL schemes, see Route.Schemes.
+func (router *Router) Schemes(schemes ...string) *Router {
+	return router.withMatchers(schemeMatcher(schemes...))
+}
+
+func hostMatcher(host string) routeMatcher {
+	return func(request *http.Request) bool {
+		h := request.Host
+		if i := strings.IndexByte(h, ':'); i >= 0 {
+			h = h[:i]
+		}
+		return h == host
+	}
+}
+
+func headerMatcher(key, value string) routeMatcher {
+	return func(request *http.Request) bool {
+		if value == "" {
+			return len(request.Header[http.CanonicalHeaderKey(key)]) > 0
+		}
+		return request.Header.Get(key) == value
+	}
+}
+
+func queryMatcher(key, value string) routeMatcher {
+	return func(request *http.Request) bool {
+		return request.URL.Query().Get(key) == value
+	}
+}
+
+func schemeMatcher(schemes ...string) routeMatcher {
+	allowed := make(map[string]bool, len(schemes))
+	for _, s := range schemes {
+		allowed[strings.ToLower(s)] = true
+	}
+	return func(request *http.Request) bool {
+		scheme := request.URL.Scheme
+		if scheme == "" {
+			if request.TLS != nil {
+				scheme = "https"
+			} else {
+				scheme = "http"
+			}
+		}
+		return allowed[strings.ToLower(scheme)]
+	}
+}
+
+// Builds one matcher per key, value pair in pairs using newMatcher.
+func pairMatchers(newMatcher func(key, value string) routeMatcher, pairs []string) []routeMatcher {
+	var matchers []routeMatcher
+	for i := 0; i+1 < len(pairs); i += 2 {
+		matchers = append(matchers, newMatcher(pairs[i], pairs[i+1]))
+	}
+	return matchers
+}
+
+// Describes how a single raw path segment should be added to the tree,
+// resolved once at AddRoute time so matching never has to re-parse or
+// re-compile a constraint.
+type segmentSpec struct {
+	kind    nodeKind
+	key     string
+	pattern *regexp.Regexp
+}
+
+// The constraints built into every Router under the names "int" and "uuid".
+// RegisterParamType can add to or override these.
+func defaultParamTypes() map[string]string {
+	return map[string]string{
+		"int":  `[0-9]+`,
+		"uuid": `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	}
+}
+
 // NewRouter initializes a new HTTP request httprouter.
 func NewRouter() *Router {
-	return new(Router)
+	return &Router{core: new(routerCore)}
 }
 
-// Adds a new route with a handler function. The router structure is also
-// returned to allow chaining.
-func (router *Router) AddRoute(verb string, path string, handler Handler) *Router {
+// Adds a new route with a handler function, returning a Route so callers
+// can narrow it further with Host, Headers, Queries, or Schemes.
+//
+// A path segment "{name}" captures any value. "{name:type}" constrains the
+// capture to a named type registered with RegisterParamType (the router
+// ships with "int" and "uuid"), or to a raw regex given directly, e.g.
+// "{slug:[a-z0-9-]+}". A segment that fails its constraint falls through to
+// other routes instead of reaching the handler.
+//
+// The handler is wrapped with any middleware registered on this router via
+// Use, composed in the order it was added, before being stored, and the
+// route inherits any predicates set on this router via Host, Headers,
+// Queries, Schemes, or PathPrefix.
+func (router *Router) AddRoute(verb string, path string, handler Handler) *Route {
 	log.Info("Adding route", log.String("verb", verb), log.String("path", path))
 
-	// Converts params in the path from "{param}" to a non-greedy regex named
-	// match, "(?P<param>.+?)"
-	if path != "/" {
-		path = strings.TrimRight(path, "/")
-		submatches := paramRE.FindAllString(path, -1)
-		for _, s := range submatches {
-			path = strings.Replace(path, s, "(?P<"+strings.Trim(s, "{}")+">.+?)", 1)
+	if router.core.root == nil {
+		router.core.root = newNode(staticNode, "")
+	}
+
+	n := router.core.root
+	for _, segment := range splitPath(router.prefix + path) {
+		n = n.addChild(router.parseSegment(segment))
+	}
+
+	if n.handlers == nil {
+		n.handlers = make(map[string][]*Route)
+	}
+
+	route := &Route{
+		handler:      compose(router.middlewares, handler),
+		matchers:     append([]routeMatcher(nil), router.matchers...),
+		middlewares:  append([]Middleware(nil), router.middlewares...),
+		core:         router.core,
+		pathTemplate: router.prefix + path,
+	}
+	n.handlers[verb] = append(n.handlers[verb], route)
+
+	return route
+}
+
+// Use appends middleware to the router, applied in registration order to
+// every route added through it afterward. Middleware added after a route
+// was registered does not apply to that route retroactively.
+func (router *Router) Use(mw ...Middleware) {
+	router.middlewares = append(router.middlewares, mw...)
+}
+
+// Group calls fn with a child router whose routes are all prefixed with
+// prefix and inherit the parent's middleware and predicates. It's a
+// convenient way to organize a batch of related routes, e.g. API
+// versioning:
+//
+//	r.Group("/v1", func(r *Router) {
+//	    r.AddRoute("GET", "/users", listUsers)
+//	})
+func (router *Router) Group(prefix string, fn func(r *Router)) {
+	fn(router.PathPrefix(prefix))
+}
+
+// PathPrefix returns a sub-router whose routes are all registered under
+// prefix and inherit this router's middleware and predicates (any set via
+// Host, Headers, Queries, or Schemes), enabling clean API versioning:
+//
+//	api := r.PathPrefix("/v1").Headers("X-API-Key", "")
+//	api.AddRoute("GET", "/users", listUsers)
+func (router *Router) PathPrefix(prefix string) *Router {
+	child := router.withMatchers()
+	child.prefix = router.prefix + prefix
+	return child
+}
+
+// With returns a child router that shares the same route tree as router but
+// layers the given middleware on top of any it already has. Routes added
+// through the child carry the combined middleware stack; routes added
+// through the parent are unaffected.
+func (router *Router) With(mw ...Middleware) *Router {
+	child := router.withMatchers()
+	child.middlewares = append(child.middlewares, mw...)
+	return child
+}
+
+// withMatchers returns a child router sharing this one's tree, prefix, and
+// overridable handlers, with matchers appended to its predicate list. Used
+// to implement Host, Headers, Queries, Schemes, PathPrefix, and With, each
+// of which derives a new view rather than mutating the receiver.
+func (router *Router) withMatchers(matchers ...routeMatcher) *Router {
+	return &Router{
+		core:                    router.core,
+		middlewares:             append([]Middleware(nil), router.middlewares...),
+		matchers:                append(append([]routeMatcher(nil), router.matchers...), matchers...),
+		prefix:                  router.prefix,
+		MethodNotAllowedHandler: router.MethodNotAllowedHandler,
+		NotFoundHandler:         router.NotFoundHandler,
+		RedirectCleanPath:       router.RedirectCleanPath,
+		RedirectTrailingSlash:   router.RedirectTrailingSlash,
+	}
+}
+
+// RegisterParamType registers a named constraint that can be referenced from
+// a route path as "{name:type}", for example:
+//
+//	router.RegisterParamType("slug", "[a-z0-9-]+")
+//	router.AddRoute("GET", "/posts/{id:slug}", handler)
+//
+// Registering a name that already exists, including the built-in "int" and
+// "uuid", overrides it for routes added afterward.
+func (router *Router) RegisterParamType(name string, re string) {
+	if router.core.paramTypes == nil {
+		router.core.paramTypes = defaultParamTypes()
+	}
+	router.core.paramTypes[name] = re
+}
+
+// URL reconstructs the URL for the route registered under name, filling its
+// "{param}" and "{param:type}" slots from the given key, value pairs and
+// validating each value against its constraint, if any. If the route was
+// restricted to a host via Host, that host is included, using the scheme
+// given to Schemes if the route was also restricted to one, defaulting to
+// "http" otherwise; if the route has no host, the returned URL carries only
+// a path, like URLPath.
+func (router *Router) URL(name string, pairs ...string) (*url.URL, error) {
+	u, err := router.URLPath(name, pairs...)
+	if err != nil {
+		return nil, err
+	}
+
+	if route := router.core.named[name]; route.host != "" {
+		u.Scheme = "http"
+		if route.scheme != "" {
+			u.Scheme = route.scheme
 		}
-		path = "^" + path + "$"
+		u.Host = route.host
+	}
+	return u, nil
+}
+
+// URLPath reconstructs just the path portion of the URL for the route
+// registered under name; see URL.
+func (router *Router) URLPath(name string, pairs ...string) (*url.URL, error) {
+	route, ok := router.core.named[name]
+	if !ok {
+		return nil, fmt.Errorf("router: no route named %q", name)
 	}
 
-	// Compile the path regex
-	re, err := regexp.Compile(path)
+	values, err := pairsToMap(pairs)
 	if err != nil {
-		log.Error("Invalid path regex", log.Err("error", err))
+		return nil, err
+	}
+
+	path, err := router.buildPath(route.pathTemplate, values)
+	if err != nil {
+		return nil, err
+	}
+	return &url.URL{Path: path}, nil
+}
+
+// Reconstructs a concrete path from template by substituting values into
+// its "{param}" and "{param:type}" slots, re-using the same parsing and
+// constraint resolution as AddRoute. Named types are resolved against the
+// registry as it is now, so a type overridden with RegisterParamType after
+// the route was added is validated with its new pattern here.
+func (router *Router) buildPath(template string, values map[string]string) (string, error) {
+	var segments []string
+	for _, raw := range splitPath(template) {
+		spec := router.parseSegment(raw)
+		if spec.kind == staticNode {
+			segments = append(segments, raw)
+			continue
+		}
+
+		value, ok := values[spec.key]
+		if !ok {
+			return "", fmt.Errorf("router: missing value for parameter %q", spec.key)
+		}
+		if spec.pattern != nil && !spec.pattern.MatchString(value) {
+			return "", fmt.Errorf("router: value %q for parameter %q does not satisfy its constraint", value, spec.key)
+		}
+		segments = append(segments, value)
+	}
+	return "/" + strings.Join(segments, "/"), nil
+}
+
+// Converts a flat key, value, key, value, ... slice into a map, as accepted
+// by URL and URLPath.
+func pairsToMap(pairs []string) (map[string]string, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("router: pairs must have an even number of elements")
+	}
+
+	values := make(map[string]string, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		values[pairs[i]] = pairs[i+1]
+	}
+	return values, nil
+}
+
+// Parses a single raw path segment from AddRoute into a segmentSpec,
+// resolving "{name:type}" constraints against the router's param type
+// registry and compiling the resulting pattern.
+func (router *Router) parseSegment(segment string) segmentSpec {
+	switch {
+	case strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}"):
+		name := strings.Trim(segment, "{}")
+		key := name
+		var pattern *regexp.Regexp
+		if i := strings.Index(name, ":"); i >= 0 {
+			key = name[:i]
+			typeSpec := name[i+1:]
+
+			if router.core.paramTypes == nil {
+				router.core.paramTypes = defaultParamTypes()
+			}
+			re, ok := router.core.paramTypes[typeSpec]
+			if !ok {
+				re = typeSpec
+			}
+			pattern = regexp.MustCompile("^(?:" + re + ")$")
+		}
+		return segmentSpec{kind: paramNode, key: key, pattern: pattern}
+	case strings.HasPrefix(segment, "*"):
+		return segmentSpec{kind: catchAllNode, key: strings.TrimPrefix(segment, "*")}
+	default:
+		return segmentSpec{kind: staticNode, key: segment}
+	}
+}
+
+// Wraps handler with mws so that the first middleware in the slice runs
+// outermost, i.e. first on the way in and last on the way out.
+func compose(mws []Middleware, handler Handler) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
 	}
+	return handler
+}
 
-	// Adds the route if no errors occurred the regex compiler.
-	var r route
-	r.handler = handler
-	r.path = re
-	r.verb = verb
+// Lookup resolves a method and path against the route tree without going
+// through the http.Handler machinery, so callers can pre-resolve routes for
+// tests or custom dispatch. The returned bool is false both when no route
+// matches the path and when the path matches but not the given verb. Since
+// there is no request to evaluate Host, Headers, Queries, or Schemes
+// predicates against, Lookup returns the first route registered for the
+// verb regardless of those predicates.
+func (router *Router) Lookup(method string, path string) (Handler, map[string]string, bool) {
+	n, params := router.match(path)
+	if n == nil {
+		return nil, nil, false
+	}
 
-	router.routes = append(router.routes, r)
-	return router
+	routes, ok := n.handlers[method]
+	if !ok || len(routes) == 0 {
+		return nil, nil, false
+	}
+	return routes[0].handler, params, true
 }
 
 // Default global request handler that matches the incoming request with a
-// registered handler.
+// registered handler. A path that matches no route responds via
+// NotFoundHandler (404 by default). A path that matches but has no handler
+// for the request's verb responds via MethodNotAllowedHandler (405 by
+// default), except for OPTIONS, which the router answers itself by listing
+// the path's registered verbs in an Allow header, unless the application
+// registered its own OPTIONS handler. That default Allow-header response is
+// still run through the matched path's middleware stack, so a middleware
+// like middleware.CORS can intercept the preflight and answer it directly.
+//
+// Before matching, RedirectCleanPath and RedirectTrailingSlash can send the
+// client to a canonical path instead of serving or 404ing the request it
+// actually sent; see their doc comments.
 func (router *Router) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	for _, r := range router.routes {
-		if request.Method == r.verb && r.path.MatchString(request.URL.Path) {
-			m := matches(r.path, request.URL.Path)
-			for k, v := range request.URL.Query() {
-				m[k] = strings.Join(v, "; ")
+	requestPath := request.URL.Path
+
+	if router.RedirectCleanPath {
+		if cleaned := cleanPath(requestPath); cleaned != requestPath {
+			redirectClean(writer, request, cleaned)
+			return
+		}
+	}
+
+	n, params := router.match(requestPath)
+	if n == nil {
+		if router.RedirectTrailingSlash {
+			if alt, ok := router.alternatePath(requestPath); ok {
+				redirectTrailingSlash(writer, request, alt)
+				return
 			}
+		}
 
-			httpRequest := new(Request)
-			httpRequest.Request = request
-			httpRequest.Params = m
+		if router.NotFoundHandler != nil {
+			router.NotFoundHandler.ServeHTTP(writer, request)
+			return
+		}
+		log.Warn("Path not found", log.String("path", requestPath))
+		writer.WriteHeader(404)
+		return
+	}
 
-			r.handler(writer, httpRequest)
+	httpRequest := new(Request)
+	httpRequest.Request = request
+	httpRequest.Params = params
+	httpRequest.QueryAll = request.URL.Query()
+
+	if request.Method == http.MethodOptions {
+		if _, ok := pickRoute(n.handlers[http.MethodOptions], request); !ok {
+			// No application route answers OPTIONS for this path, so run the
+			// default Allow-header response through the matched path's
+			// middleware stack instead of writing it directly - that's what lets a
+			// middleware like middleware.CORS answer the preflight itself.
+			allowed := n.allowedMethods()
+			compose(n.middlewares(), func(writer http.ResponseWriter, request *Request) {
+				writer.Header().Set("Allow", allowed)
+				writer.WriteHeader(http.StatusOK)
+			})(writer, httpRequest)
 			return
 		}
 	}
-	log.Warn("Path not found", log.String("path", request.URL.Path))
-	writer.WriteHeader(404)
+
+	route, ok := pickRoute(n.handlers[request.Method], request)
+	if !ok {
+		if router.MethodNotAllowedHandler != nil {
+			router.MethodNotAllowedHandler.ServeHTTP(writer, request)
+			return
+		}
+		log.Warn("Method not allowed", log.String("path", requestPath), log.String("verb", request.Method))
+		writer.Header().Set("Allow", n.allowedMethods())
+		writer.WriteHeader(405)
+		return
+	}
+
+	route.handler(writer, httpRequest)
+}
+
+// Returns the first route in routes whose predicates all match request, so
+// that, e.g., a Host-restricted route and a catch-all route can share the
+// same verb and path.
+func pickRoute(routes []*Route, request *http.Request) (*Route, bool) {
+	for _, route := range routes {
+		if route.matches(request) {
+			return route, true
+		}
+	}
+	return nil, false
 }
 
-// Helper that applies the path regex to the incoming path to parse param
-// values from it.
-func matches(re *regexp.Regexp, s string) map[string]string {
-	submatches := re.FindStringSubmatch(s)
-	matches := make(map[string]string)
-	for i, name := range re.SubexpNames() {
-		if i > 0 && name != "" {
-			matches[name] = submatches[i]
+// cleanPath normalizes p the way julienschmidt/httprouter does: it
+// collapses duplicate slashes, resolves "." and ".." segments, and ensures
+// a leading slash, preserving a trailing slash if p had one. Used by
+// RedirectCleanPath.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+
+	trailingSlash := len(p) > 1 && p[len(p)-1] == '/'
+	cleaned := path.Clean(p)
+	if trailingSlash && !strings.HasSuffix(cleaned, "/") {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// If requestPath matches no route but toggling its trailing slash would
+// match one, alternatePath returns that alternate path. Used by
+// RedirectTrailingSlash.
+func (router *Router) alternatePath(requestPath string) (string, bool) {
+	var alt string
+	if strings.HasSuffix(requestPath, "/") {
+		alt = strings.TrimSuffix(requestPath, "/")
+		if alt == "" {
+			alt = "/"
 		}
+	} else {
+		alt = requestPath + "/"
 	}
-	return matches
+
+	if n, _ := router.match(alt); n != nil {
+		return alt, true
+	}
+	return "", false
+}
+
+// Builds the absolute URL a redirect to path should carry in its Location
+// header. request.URL, as seen by a server, has no Scheme or Host, so those
+// come from request.Host and whether the connection is over TLS; the query
+// string is preserved as-is.
+func redirectLocation(request *http.Request, path string) *url.URL {
+	scheme := "http"
+	if request.TLS != nil {
+		scheme = "https"
+	}
+	return &url.URL{
+		Scheme:   scheme,
+		Host:     request.Host,
+		Path:     path,
+		RawQuery: request.URL.RawQuery,
+	}
+}
+
+// Redirects request to path with a 301, preserving its query string. Used
+// by RedirectCleanPath, whose canonical form is always safe to replay.
+func redirectClean(writer http.ResponseWriter, request *http.Request, path string) {
+	http.Redirect(writer, request, redirectLocation(request, path).String(), http.StatusMovedPermanently)
+}
+
+// Redirects request to path with a 301 for GET and HEAD or a 307 for any
+// other method, so the request body, if any, survives the redirect. Used by
+// RedirectTrailingSlash.
+func redirectTrailingSlash(writer http.ResponseWriter, request *http.Request, path string) {
+	status := http.StatusMovedPermanently
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		status = http.StatusTemporaryRedirect
+	}
+	http.Redirect(writer, request, redirectLocation(request, path).String(), status)
+}
+
+// Walks the route tree for path, returning the node it resolves to (if any)
+// and the path parameters collected along the way. A non-nil node means the
+// path matched some route, regardless of whether the node carries a handler
+// for the request's verb.
+func (router *Router) match(path string) (*node, map[string]string) {
+	if router.core.root == nil {
+		return nil, nil
+	}
+
+	params := make(map[string]string)
+	n, ok := router.core.root.match(splitRequestPath(path), params)
+	if !ok {
+		return nil, nil
+	}
+	return n, params
+}
+
+// Finds or creates the child of n described by spec, creating static,
+// param, or catch-all nodes as appropriate. A param spec reuses an existing
+// child only if its name and constraint both match, since two routes may
+// legitimately place differently-typed params at the same tree position. A
+// path can only have one catch-all at a given position, since match fills
+// in a single params key for it before a verb is even chosen; registering a
+// second catch-all there under a different name would silently misname the
+// parameter for every route but the first, so it panics instead.
+func (n *node) addChild(spec segmentSpec) *node {
+	switch spec.kind {
+	case paramNode:
+		for _, p := range n.params {
+			if p.key == spec.key && samePattern(p.pattern, spec.pattern) {
+				return p
+			}
+		}
+		child := newNode(paramNode, spec.key)
+		child.pattern = spec.pattern
+		n.params = append(n.params, child)
+		return child
+	case catchAllNode:
+		if n.catchAll == nil {
+			n.catchAll = newNode(catchAllNode, spec.key)
+		} else if n.catchAll.key != spec.key {
+			panic(fmt.Sprintf("router: catch-all already registered here as %q, cannot also register %q", n.catchAll.key, spec.key))
+		}
+		return n.catchAll
+	default:
+		child, ok := n.static[spec.key]
+		if !ok {
+			child = newNode(staticNode, spec.key)
+			n.static[spec.key] = child
+		}
+		return child
+	}
+}
+
+// Reports whether two param constraints are equivalent, treating "no
+// constraint" as its own pattern.
+func samePattern(a, b *regexp.Regexp) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.String() == b.String()
+}
+
+// Matches segments against the subtree rooted at n, preferring static
+// children over param children over a catch-all, and backtracking when a
+// preferred branch turns out to be a dead end.
+func (n *node) match(segments []string, params map[string]string) (*node, bool) {
+	if len(segments) == 0 {
+		if len(n.handlers) > 0 {
+			return n, true
+		}
+		return nil, false
+	}
+
+	segment, rest := segments[0], segments[1:]
+
+	if child, ok := n.static[segment]; ok {
+		if found, ok := child.match(rest, params); ok {
+			return found, true
+		}
+	}
+
+	for _, p := range n.params {
+		if p.pattern != nil && !p.pattern.MatchString(segment) {
+			continue
+		}
+
+		previous, had := params[p.key]
+		params[p.key] = segment
+		if found, ok := p.match(rest, params); ok {
+			return found, true
+		}
+		if had {
+			params[p.key] = previous
+		} else {
+			delete(params, p.key)
+		}
+	}
+
+	if n.catchAll != nil {
+		params[n.catchAll.key] = strings.Join(segments, "/")
+		return n.catchAll, true
+	}
+
+	return nil, false
+}
+
+// Returns a sorted, comma-separated list of the verbs registered on n, for
+// use in an Allow header.
+func (n *node) allowedMethods() string {
+	methods := make([]string, 0, len(n.handlers))
+	for verb := range n.handlers {
+		methods = append(methods, verb)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+// Returns the middleware stack of some route registered on n, for composing
+// the default OPTIONS response. n always has at least one registered route
+// by the time this is called. Routes for different verbs at the same path
+// are assumed to share a middleware stack, since they're almost always
+// registered through the same Router view; if they don't, which one wins is
+// unspecified.
+func (n *node) middlewares() []Middleware {
+	for _, routes := range n.handlers {
+		if len(routes) > 0 {
+			return routes[0].middlewares
+		}
+	}
+	return nil
+}
+
+// Splits a route template into its non-empty segments, trimming a trailing
+// slash so that "/foo/" and "/foo" register the same node. Used by AddRoute
+// and buildPath; incoming requests are split with splitRequestPath instead,
+// which does not discard a trailing slash.
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// Splits an incoming request path into segments, trimming only the leading
+// slash. Unlike splitPath, a trailing slash produces a trailing empty
+// segment, so "/foo/" won't match a route registered as "/foo" unless
+// RedirectTrailingSlash sends the client to the canonical form first.
+func splitRequestPath(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func newNode(kind nodeKind, key string) *node {
+	return &node{kind: kind, key: key, static: make(map[string]*node)}
 }
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -34,28 +35,425 @@ func TestRouter_AddRoute(t *testing.T) {
 	r.AddRoute("GET", "/path/{foo}/{bar}", func(writer http.ResponseWriter, request *Request) {
 	})
 
-	if r.routes == nil {
-		t.Error("Routes must not be nil")
+	if r.core.root == nil {
+		t.Error("Route tree must not be nil")
 	}
 
-	if len(r.routes) != 1 {
-		t.Error("Routes must contain one route")
+	handler, params, ok := r.Lookup("GET", "/path/fuz/baz")
+	if !ok {
+		t.Fatal("Expected route to match")
 	}
 
-	s := r.routes[0]
-
-	if s.handler == nil {
+	if handler == nil {
 		t.Error("Route handler must not be nil")
 	}
 
-	actual := s.path.String()
-	expected := "^/path/(?P<foo>.+?)/(?P<bar>.+?)$"
-	if actual != expected {
-		t.Errorf("Path regex failed. Expected: \"%s\" Actual: \"%s\"", expected, actual)
+	if params["foo"] != "fuz" {
+		t.Errorf("Param foo failed. Expected:fuz Actual:%s", params["foo"])
+	}
+
+	if params["bar"] != "baz" {
+		t.Errorf("Param bar failed. Expected:baz Actual:%s", params["bar"])
+	}
+}
+
+func TestRouter_Lookup_MethodNotAllowed(t *testing.T) {
+	r := NewRouter()
+	r.AddRoute("GET", "/path", func(writer http.ResponseWriter, request *Request) {})
+
+	if _, _, ok := r.Lookup("POST", "/path"); ok {
+		t.Error("Lookup must not match a route registered under a different verb")
+	}
+
+	if _, _, ok := r.Lookup("GET", "/other"); ok {
+		t.Error("Lookup must not match an unregistered path")
+	}
+}
+
+func TestRouter_AddRoute_TypedConstraint(t *testing.T) {
+	r := NewRouter()
+	r.AddRoute("GET", "/users/{id:int}", func(writer http.ResponseWriter, request *Request) {})
+
+	if _, _, ok := r.Lookup("GET", "/users/42"); !ok {
+		t.Error("Expected {id:int} to match a numeric segment")
+	}
+
+	if _, _, ok := r.Lookup("GET", "/users/abc"); ok {
+		t.Error("Expected {id:int} not to match a non-numeric segment")
+	}
+}
+
+func TestRouter_AddRoute_InlineRegexConstraint(t *testing.T) {
+	r := NewRouter()
+	r.AddRoute("GET", "/posts/{slug:[a-z-]+}", func(writer http.ResponseWriter, request *Request) {})
+
+	handler, params, ok := r.Lookup("GET", "/posts/hello-world")
+	if !ok || handler == nil {
+		t.Error("Expected {slug:[a-z-]+} to match a lowercase slug")
+	}
+	if params["slug"] != "hello-world" {
+		t.Errorf("Param slug failed. Expected:hello-world Actual:%s", params["slug"])
+	}
+
+	if _, _, ok := r.Lookup("GET", "/posts/Hello_World"); ok {
+		t.Error("Expected {slug:[a-z-]+} not to match an uppercase or underscored segment")
+	}
+}
+
+func TestRouter_AddRoute_CatchAll(t *testing.T) {
+	r := NewRouter()
+	r.AddRoute("GET", "/files/*filepath", func(writer http.ResponseWriter, request *Request) {})
+
+	_, params, ok := r.Lookup("GET", "/files/a/b/c")
+	if !ok {
+		t.Fatal("Expected *filepath to match a multi-segment path")
+	}
+	if params["filepath"] != "a/b/c" {
+		t.Errorf("Param filepath failed. Expected:a/b/c Actual:%s", params["filepath"])
+	}
+}
+
+func TestRouter_AddRoute_CatchAllNameConflict(t *testing.T) {
+	r := NewRouter()
+	r.AddRoute("GET", "/files/*filepath", func(writer http.ResponseWriter, request *Request) {})
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a second catch-all with a different name at the same position to panic")
+		}
+	}()
+	r.AddRoute("POST", "/files/*rest", func(writer http.ResponseWriter, request *Request) {})
+}
+
+func TestRouter_Match_Precedence(t *testing.T) {
+	var matched string
+
+	r := NewRouter()
+	r.AddRoute("GET", "/files/static", func(writer http.ResponseWriter, request *Request) {
+		matched = "static"
+	})
+	r.AddRoute("GET", "/files/{name}", func(writer http.ResponseWriter, request *Request) {
+		matched = "param"
+	})
+	r.AddRoute("GET", "/files/*rest", func(writer http.ResponseWriter, request *Request) {
+		matched = "catchall"
+	})
+
+	cases := map[string]string{
+		"/files/static": "static",
+		"/files/other":  "param",
+		"/files/a/b":    "catchall",
+	}
+	for path, want := range cases {
+		matched = ""
+		handler, _, ok := r.Lookup("GET", path)
+		if !ok {
+			t.Fatalf("Lookup(%q) failed to match", path)
+		}
+		handler(nil, &Request{})
+		if matched != want {
+			t.Errorf("Lookup(%q) matched %s, want %s", path, matched, want)
+		}
+	}
+}
+
+func TestRouter_RegisterParamType(t *testing.T) {
+	r := NewRouter()
+	r.RegisterParamType("isbn", `[0-9]{3}-[0-9]{10}`)
+	r.AddRoute("GET", "/books/{isbn:isbn}", func(writer http.ResponseWriter, request *Request) {})
+
+	if _, _, ok := r.Lookup("GET", "/books/978-0316371247"); !ok {
+		t.Error("Expected registered isbn constraint to match")
+	}
+
+	if _, _, ok := r.Lookup("GET", "/books/not-an-isbn"); ok {
+		t.Error("Expected registered isbn constraint to reject a non-matching segment")
+	}
+}
+
+func TestRouter_Use(t *testing.T) {
+	var order []string
+
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(writer http.ResponseWriter, request *Request) {
+				order = append(order, name)
+				next(writer, request)
+			}
+		}
+	}
+
+	r := NewRouter()
+	r.Use(mark("first"), mark("second"))
+	r.AddRoute("GET", "/path", func(writer http.ResponseWriter, request *Request) {
+		order = append(order, "handler")
+		writer.WriteHeader(200)
+	})
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	if _, err := http.Get(server.URL + "/path"); err != nil {
+		t.Fatalf("GET failed with %v", err)
+	}
+
+	expected := []string{"first", "second", "handler"}
+	if len(order) != len(expected) {
+		t.Fatalf("Expected call order %v, got %v", expected, order)
+	}
+	for i, name := range expected {
+		if order[i] != name {
+			t.Errorf("Expected call order %v, got %v", expected, order)
+			break
+		}
+	}
+}
+
+func TestRouter_Group(t *testing.T) {
+	r := NewRouter()
+	r.Group("/v1", func(r *Router) {
+		r.AddRoute("GET", "/users", func(writer http.ResponseWriter, request *Request) {})
+	})
+
+	if _, _, ok := r.Lookup("GET", "/v1/users"); !ok {
+		t.Error("Expected route grouped under /v1 to be registered with its prefix")
+	}
+}
+
+func TestRouter_With(t *testing.T) {
+	applied := false
+	mw := func(next Handler) Handler {
+		return func(writer http.ResponseWriter, request *Request) {
+			applied = true
+			next(writer, request)
+		}
+	}
+
+	r := NewRouter()
+	r.AddRoute("GET", "/plain", func(writer http.ResponseWriter, request *Request) {
+		writer.WriteHeader(200)
+	})
+	r.With(mw).AddRoute("GET", "/wrapped", func(writer http.ResponseWriter, request *Request) {
+		writer.WriteHeader(200)
+	})
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	if _, err := http.Get(server.URL + "/plain"); err != nil {
+		t.Fatalf("GET failed with %v", err)
+	}
+	if applied {
+		t.Error("Middleware from With must not affect routes added on the parent router")
+	}
+
+	if _, err := http.Get(server.URL + "/wrapped"); err != nil {
+		t.Fatalf("GET failed with %v", err)
+	}
+	if !applied {
+		t.Error("Middleware from With must wrap routes added on the child router")
+	}
+}
+
+func TestRoute_Host(t *testing.T) {
+	router := NewRouter()
+	router.AddRoute("GET", "/path", func(writer http.ResponseWriter, request *Request) {
+		writer.WriteHeader(200)
+	}).Host("api.example.com")
+	router.AddRoute("GET", "/path", func(writer http.ResponseWriter, request *Request) {
+		writer.WriteHeader(201)
+	})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", server.URL+"/path", nil)
+	if err != nil {
+		t.Fatalf("Building request failed with %v", err)
+	}
+	req.Host = "api.example.com"
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed with %v", err)
+	}
+	if res.StatusCode != 200 {
+		t.Errorf("Response code failed. Expected:200 Actual:%d", res.StatusCode)
+	}
+
+	res, err = http.Get(server.URL + "/path")
+	if err != nil {
+		t.Fatalf("GET failed with %v", err)
+	}
+	if res.StatusCode != 201 {
+		t.Errorf("Response code failed. Expected:201 Actual:%d", res.StatusCode)
+	}
+}
+
+func TestRouter_PathPrefix_InheritsPredicate(t *testing.T) {
+	router := NewRouter()
+	api := router.PathPrefix("/v1").Headers("X-API-Key", "secret")
+	api.AddRoute("GET", "/users", func(writer http.ResponseWriter, request *Request) {
+		writer.WriteHeader(200)
+	})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", server.URL+"/v1/users", nil)
+	if err != nil {
+		t.Fatalf("Building request failed with %v", err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed with %v", err)
+	}
+	if res.StatusCode != 405 {
+		t.Errorf("Expected request missing X-API-Key to be rejected. Response code:%d", res.StatusCode)
+	}
+
+	req.Header.Set("X-API-Key", "secret")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed with %v", err)
+	}
+	if res.StatusCode != 200 {
+		t.Errorf("Expected request with X-API-Key to succeed. Response code:%d", res.StatusCode)
+	}
+}
+
+func TestRouter_URL(t *testing.T) {
+	r := NewRouter()
+	r.AddRoute("GET", "/books/{isbn:int}", func(writer http.ResponseWriter, request *Request) {}).Name("book")
+
+	u, err := r.URL("book", "isbn", "9780316371247")
+	if err != nil {
+		t.Fatalf("URL failed with %v", err)
+	}
+	if u.Path != "/books/9780316371247" {
+		t.Errorf("URL path failed. Expected:/books/9780316371247 Actual:%s", u.Path)
+	}
+
+	if _, err := r.URL("book", "isbn", "not-a-number"); err == nil {
+		t.Error("Expected URL to reject a value that fails the route's constraint")
+	}
+
+	if _, err := r.URL("book"); err == nil {
+		t.Error("Expected URL to fail when a required parameter is missing")
+	}
+
+	if _, err := r.URL("missing-route"); err == nil {
+		t.Error("Expected URL to fail for an unregistered route name")
+	}
+}
+
+func TestRouter_URL_WithHost(t *testing.T) {
+	r := NewRouter()
+	r.AddRoute("GET", "/users/{id}", func(writer http.ResponseWriter, request *Request) {}).
+		Host("api.example.com").
+		Name("user")
+
+	u, err := r.URLPath("user", "id", "42")
+	if err != nil {
+		t.Fatalf("URLPath failed with %v", err)
+	}
+	if u.Host != "" {
+		t.Errorf("URLPath must not set a host, got %s", u.Host)
+	}
+
+	u, err = r.URL("user", "id", "42")
+	if err != nil {
+		t.Fatalf("URL failed with %v", err)
+	}
+	if u.Host != "api.example.com" {
+		t.Errorf("URL host failed. Expected:api.example.com Actual:%s", u.Host)
+	}
+	if u.Path != "/users/42" {
+		t.Errorf("URL path failed. Expected:/users/42 Actual:%s", u.Path)
 	}
+}
+
+func TestRouter_URL_WithScheme(t *testing.T) {
+	r := NewRouter()
+	r.AddRoute("GET", "/users/{id}", func(writer http.ResponseWriter, request *Request) {}).
+		Host("api.example.com").
+		Schemes("https").
+		Name("user")
 
-	if s.verb != "GET" {
-		t.Error("Route verb must be GET")
+	u, err := r.URL("user", "id", "42")
+	if err != nil {
+		t.Fatalf("URL failed with %v", err)
+	}
+	if u.Scheme != "https" {
+		t.Errorf("URL scheme failed. Expected:https Actual:%s", u.Scheme)
+	}
+}
+
+func TestRequest_QueryValues_MultiValue(t *testing.T) {
+	router := NewRouter()
+	router.AddRoute("GET", "/search", func(writer http.ResponseWriter, request *Request) {
+		tags := request.QueryValues("tag")
+		if len(tags) != 2 || tags[0] != "go" || tags[1] != "router" {
+			t.Errorf("Expected QueryValues(\"tag\") to be [\"go\" \"router\"], got %v", tags)
+		}
+		if request.Query("tag") != "go" {
+			t.Errorf("Expected Query(\"tag\") to return the first value, got %s", request.Query("tag"))
+		}
+		writer.WriteHeader(200)
+	})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	if _, err := http.Get(server.URL + "/search?tag=go&tag=router"); err != nil {
+		t.Fatalf("GET failed with %v", err)
+	}
+}
+
+func TestRequest_Bind(t *testing.T) {
+	type Search struct {
+		ISBN      string `router:"isbn"`
+		Sort      string `query:"sort"`
+		RequestID string `header:"X-Request-ID"`
+		Title     string `json:"title"`
+	}
+
+	router := NewRouter()
+	router.AddRoute("POST", "/books/{isbn}", func(writer http.ResponseWriter, request *Request) {
+		var s Search
+		if err := request.Bind(&s); err != nil {
+			t.Fatalf("Bind failed with %v", err)
+		}
+
+		if s.ISBN != "978-0316371247" {
+			t.Errorf("Bind router tag failed. Expected:978-0316371247 Actual:%s", s.ISBN)
+		}
+		if s.Sort != "asc" {
+			t.Errorf("Bind query tag failed. Expected:asc Actual:%s", s.Sort)
+		}
+		if s.RequestID != "abc-123" {
+			t.Errorf("Bind header tag failed. Expected:abc-123 Actual:%s", s.RequestID)
+		}
+		if s.Title != "Ready Player One" {
+			t.Errorf("Bind JSON body failed. Expected:\"Ready Player One\" Actual:%s", s.Title)
+		}
+
+		writer.WriteHeader(200)
+	})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	req, err := http.NewRequest("POST", server.URL+"/books/978-0316371247?sort=asc",
+		strings.NewReader(`{"title":"Ready Player One"}`))
+	if err != nil {
+		t.Fatalf("Building request failed with %v", err)
+	}
+	req.Header.Set("X-Request-ID", "abc-123")
+
+	if _, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("POST failed with %v", err)
 	}
 }
 
@@ -63,9 +461,9 @@ func TestRouter_ServeHTTP(t *testing.T) {
 	// Create the router
 	router := NewRouter()
 	router.AddRoute("GET", "/path/{foo}/{bar}", func(writer http.ResponseWriter, request *Request) {
-		if len(request.Params) != 4 {
+		if len(request.Params) != 2 {
 			// Test for the params map.
-			t.Errorf("Param failed. Expected \"4\" Actual: \"%d\"", len(request.Params))
+			t.Errorf("Param failed. Expected \"2\" Actual: \"%d\"", len(request.Params))
 		}
 
 		p := request.Params["foo"]
@@ -78,14 +476,14 @@ func TestRouter_ServeHTTP(t *testing.T) {
 			t.Errorf("Param bar failed. Expected:baz Actual:%s", p)
 		}
 
-		p = request.Params["aaa"]
+		p = request.Query("aaa")
 		if p != "bbb" {
-			t.Errorf("Param aaa failed. Expected:baz Actual:%s", p)
+			t.Errorf("Query aaa failed. Expected:bbb Actual:%s", p)
 		}
 
-		p = request.Params["ccc"]
+		p = request.Query("ccc")
 		if p != "ddd" {
-			t.Errorf("Param ccc failed. Expected:baz Actual:%s", p)
+			t.Errorf("Query ccc failed. Expected:ddd Actual:%s", p)
 		}
 
 		writer.WriteHeader(200)
@@ -118,12 +516,210 @@ func TestRouter_ServeHTTP(t *testing.T) {
 	}
 }
 
+func TestRouter_ServeHTTP_MethodNotAllowed(t *testing.T) {
+	router := NewRouter()
+	router.AddRoute("GET", "/path", func(writer http.ResponseWriter, request *Request) {
+		writer.WriteHeader(200)
+	})
+	router.AddRoute("POST", "/path", func(writer http.ResponseWriter, request *Request) {
+		writer.WriteHeader(200)
+	})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/path")
+	if err != nil {
+		t.Fatalf("GET failed with %v", err)
+	}
+	res.Body.Close()
+
+	res, err = http.Post(server.URL+"/path", "text/plain", nil)
+	if err != nil {
+		t.Fatalf("POST failed with %v", err)
+	}
+	res.Body.Close()
+
+	req, err := http.NewRequest("DELETE", server.URL+"/path", nil)
+	if err != nil {
+		t.Fatalf("Building request failed with %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("DELETE failed with %v", err)
+	}
+
+	if resp.StatusCode != 405 {
+		t.Errorf("Response code failed. Expected:405 Actual:%d", resp.StatusCode)
+	}
+
+	if allow := resp.Header.Get("Allow"); allow != "GET, POST" {
+		t.Errorf("Allow header failed. Expected:\"GET, POST\" Actual:%q", allow)
+	}
+}
+
+func TestRouter_ServeHTTP_OptionsAutoResponse(t *testing.T) {
+	router := NewRouter()
+	router.AddRoute("GET", "/path", func(writer http.ResponseWriter, request *Request) {})
+	router.AddRoute("POST", "/path", func(writer http.ResponseWriter, request *Request) {})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	req, err := http.NewRequest("OPTIONS", server.URL+"/path", nil)
+	if err != nil {
+		t.Fatalf("Building request failed with %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("OPTIONS failed with %v", err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Errorf("Response code failed. Expected:200 Actual:%d", resp.StatusCode)
+	}
+	if allow := resp.Header.Get("Allow"); allow != "GET, POST" {
+		t.Errorf("Allow header failed. Expected:\"GET, POST\" Actual:%q", allow)
+	}
+}
+
+func TestRouter_ServeHTTP_MethodNotAllowedHandlerOverride(t *testing.T) {
+	router := NewRouter()
+	called := false
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		called = true
+		writer.WriteHeader(418)
+	})
+	router.AddRoute("GET", "/path", func(writer http.ResponseWriter, request *Request) {})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/path", "text/plain", nil)
+	if err != nil {
+		t.Fatalf("POST failed with %v", err)
+	}
+
+	if !called {
+		t.Error("Expected MethodNotAllowedHandler to be called")
+	}
+	if res.StatusCode != 418 {
+		t.Errorf("Response code failed. Expected:418 Actual:%d", res.StatusCode)
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	cases := map[string]string{
+		"":             "/",
+		"/":            "/",
+		"/foo":         "/foo",
+		"//foo":        "/foo",
+		"/foo//bar":    "/foo/bar",
+		"/foo/./bar":   "/foo/bar",
+		"/foo/../bar":  "/bar",
+		"/foo/":        "/foo/",
+		"//foo//bar//": "/foo/bar/",
+		"foo/bar":      "/foo/bar",
+	}
+	for in, want := range cases {
+		if got := cleanPath(in); got != want {
+			t.Errorf("cleanPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRouter_ServeHTTP_RedirectCleanPath(t *testing.T) {
+	router := NewRouter()
+	router.RedirectCleanPath = true
+	router.AddRoute("GET", "/path", func(writer http.ResponseWriter, request *Request) {
+		writer.WriteHeader(200)
+	})
+
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	res, err := client.Get(server.URL + "//path/../path")
+	if err != nil {
+		t.Fatalf("GET failed with %v", err)
+	}
+
+	if res.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("Response code failed. Expected:301 Actual:%d", res.StatusCode)
+	}
+	if location := res.Header.Get("Location"); location != server.URL+"/path" {
+		t.Errorf("Location header failed. Expected:%q Actual:%q", server.URL+"/path", location)
+	}
+}
+
+func TestRouter_ServeHTTP_RedirectTrailingSlash(t *testing.T) {
+	router := NewRouter()
+	router.RedirectTrailingSlash = true
+	router.AddRoute("GET", "/path", func(writer http.ResponseWriter, request *Request) {
+		writer.WriteHeader(200)
+	})
+	router.AddRoute("POST", "/path", func(writer http.ResponseWriter, request *Request) {
+		writer.WriteHeader(200)
+	})
+
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	res, err := client.Get(server.URL + "/path/")
+	if err != nil {
+		t.Fatalf("GET failed with %v", err)
+	}
+	if res.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("Response code failed. Expected:301 Actual:%d", res.StatusCode)
+	}
+	if location := res.Header.Get("Location"); location != server.URL+"/path" {
+		t.Errorf("Location header failed. Expected:%q Actual:%q", server.URL+"/path", location)
+	}
+
+	req, err := http.NewRequest("POST", server.URL+"/path/", strings.NewReader("body"))
+	if err != nil {
+		t.Fatalf("Building request failed with %v", err)
+	}
+	res, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed with %v", err)
+	}
+	if res.StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("Response code failed. Expected:307 Actual:%d", res.StatusCode)
+	}
+}
+
+func TestRouter_ServeHTTP_NoRedirectTrailingSlashByDefault(t *testing.T) {
+	router := NewRouter()
+	router.AddRoute("GET", "/path", func(writer http.ResponseWriter, request *Request) {
+		writer.WriteHeader(200)
+	})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/path/")
+	if err != nil {
+		t.Fatalf("GET failed with %v", err)
+	}
+	if res.StatusCode != 404 {
+		t.Errorf("Response code failed. Expected:404 Actual:%d", res.StatusCode)
+	}
+}
+
 // Examples that describe how to implement route handlers that accept query
 // parameters and path variables.
 func Example() {
 	// Sample search handler.
 	search := func(writer http.ResponseWriter, request *Request) {
-		fmt.Printf("Search for: \"%s\"\n", request.Params["s"])
+		fmt.Printf("Search for: \"%s\"\n", request.Query("s"))
 		writer.WriteHeader(200)
 	}
 
@@ -134,9 +730,9 @@ func Example() {
 	}
 
 	// build the router.
-	router := NewRouter().
-		AddRoute("GET", "/search", search).
-		AddRoute("GET", "/book/{isbn}", getBookByIsbn)
+	router := NewRouter()
+	router.AddRoute("GET", "/search", search)
+	router.AddRoute("GET", "/book/{isbn}", getBookByIsbn)
 
 	// Start the server.
 	server := httptest.NewServer(router)